@@ -1,8 +1,11 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/Jeffail/benthos/v3/lib/expression/x/parser"
 )
@@ -22,6 +25,11 @@ const (
 	arithmeticLt
 	arithmeticGte
 	arithmeticLte
+	arithmeticAnd
+	arithmeticOr
+	arithmeticMod
+	arithmeticPow
+	arithmeticCoalesce
 )
 
 func arithmeticOpParser() parser.Type {
@@ -29,6 +37,7 @@ func arithmeticOpParser() parser.Type {
 		parser.Char('+'),
 		parser.Char('-'),
 		parser.Char('/'),
+		parser.Match("**"),
 		parser.Char('*'),
 		parser.Match("=="),
 		parser.Match("!="),
@@ -36,6 +45,10 @@ func arithmeticOpParser() parser.Type {
 		parser.Match("<="),
 		parser.Char('>'),
 		parser.Char('<'),
+		parser.Match("&&"),
+		parser.Match("||"),
+		parser.Match("??"),
+		parser.Char('%'),
 	)
 	return func(input []rune) parser.Result {
 		res := opParser(input)
@@ -51,6 +64,8 @@ func arithmeticOpParser() parser.Type {
 			res.Result = arithmeticDiv
 		case "*":
 			res.Result = arithmeticMul
+		case "**":
+			res.Result = arithmeticPow
 		case "==":
 			res.Result = arithmeticEq
 		case "!=":
@@ -63,6 +78,14 @@ func arithmeticOpParser() parser.Type {
 			res.Result = arithmeticGte
 		case "<=":
 			res.Result = arithmeticLte
+		case "&&":
+			res.Result = arithmeticAnd
+		case "||":
+			res.Result = arithmeticOr
+		case "%":
+			res.Result = arithmeticMod
+		case "??":
+			res.Result = arithmeticCoalesce
 		default:
 			return parser.Result{
 				Remaining: input,
@@ -73,49 +96,247 @@ func arithmeticOpParser() parser.Type {
 	}
 }
 
-func getNumber(v interface{}) (float64, error) {
+// number is a tagged numeric value that preserves int64 precision through a
+// chain of arithmetic operations, only falling back to float64 once a float
+// is encountered (or an operation, such as division, produces a
+// non-integral result). This avoids the precision loss that comes from
+// round-tripping large integer IDs through float64.
+type number struct {
+	i     int64
+	f     float64
+	isInt bool
+}
+
+func intNumber(i int64) number     { return number{i: i, isInt: true} }
+func floatNumber(f float64) number { return number{f: f} }
+
+// Float returns the number as a float64, regardless of how it's stored.
+func (n number) Float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+// Value returns the number as either an int64 or a float64, matching
+// whatever type it's currently tagged as.
+func (n number) Value() interface{} {
+	if n.isInt {
+		return n.i
+	}
+	return n.f
+}
+
+func getNumber(v interface{}) (number, error) {
 	switch t := v.(type) {
 	case int64:
-		return float64(t), nil
+		return intNumber(t), nil
 	case float64:
-		return t, nil
+		return floatNumber(t), nil
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return intNumber(i), nil
+		}
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return number{}, err
+		}
+		return floatNumber(f), nil
+	}
+	return number{}, fmt.Errorf("function returned non-numerical type: %T", v)
+}
+
+// stringifyValue renders an arbitrary resolved value as a string for use in
+// `+` concatenation.
+func stringifyValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// stringRepeatOperands detects the `string * int` (or `int * string`)
+// pairing used to repeat a string, à la Python.
+func stringRepeatOperands(a, b interface{}) (str string, count int, ok bool) {
+	if s, isStr := a.(string); isStr {
+		if n, isInt := b.(int64); isInt {
+			return s, int(n), true
+		}
+	}
+	if s, isStr := b.(string); isStr {
+		if n, isInt := a.(int64); isInt {
+			return s, int(n), true
+		}
+	}
+	return "", 0, false
+}
+
+func addNumbers(lhs, rhs number) number {
+	if lhs.isInt && rhs.isInt {
+		return intNumber(lhs.i + rhs.i)
+	}
+	return floatNumber(lhs.Float() + rhs.Float())
+}
+
+func subNumbers(lhs, rhs number) number {
+	if lhs.isInt && rhs.isInt {
+		return intNumber(lhs.i - rhs.i)
+	}
+	return floatNumber(lhs.Float() - rhs.Float())
+}
+
+func mulNumbers(lhs, rhs number) number {
+	if lhs.isInt && rhs.isInt {
+		return intNumber(lhs.i * rhs.i)
+	}
+	return floatNumber(lhs.Float() * rhs.Float())
+}
+
+func divNumbers(lhs, rhs number) number {
+	if lhs.isInt && rhs.isInt && rhs.i != 0 && lhs.i%rhs.i == 0 {
+		return intNumber(lhs.i / rhs.i)
+	}
+	return floatNumber(lhs.Float() / rhs.Float())
+}
+
+// modNumbers implements `%`. Integer operands use Go's integer remainder;
+// float operands fall back to math.Mod semantics rather than being rejected,
+// matching the permissive type coercion of the other arithmetic operators.
+// A zero divisor is an error in both cases.
+func modNumbers(lhs, rhs number) (number, error) {
+	if lhs.isInt && rhs.isInt {
+		if rhs.i == 0 {
+			return number{}, errors.New("cannot modulo by zero")
+		}
+		return intNumber(lhs.i % rhs.i), nil
+	}
+	if rhs.Float() == 0 {
+		return number{}, errors.New("cannot modulo by zero")
+	}
+	return floatNumber(math.Mod(lhs.Float(), rhs.Float())), nil
+}
+
+func modulo(lhs, rhs Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		leftV, err := lhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		rightV, err := rhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		lhsN, err := getNumber(leftV)
+		if err != nil {
+			return nil, err
+		}
+		rhsN, err := getNumber(rightV)
+		if err != nil {
+			return nil, err
+		}
+		result, err := modNumbers(lhsN, rhsN)
+		if err != nil {
+			return nil, err
+		}
+		return result.Value(), nil
+	})
+}
+
+// isTruthy coerces an arbitrary resolved value into a boolean: an empty
+// string, a zero number and nil are false, everything else (including a
+// non-empty string) is true.
+func isTruthy(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case nil:
+		return false
 	case string:
-		return strconv.ParseFloat(t, 64)
+		return len(t) > 0
+	case int64:
+		return t != 0
+	case float64:
+		return t != 0
 	}
-	return 0, fmt.Errorf("function returned non-numerical type: %T", v)
+	return true
 }
 
 func add(fns []Function) Function {
 	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
-		var total float64
+		values := make([]interface{}, len(fns))
+		resolved := make([]bool, len(fns))
 		var err error
-
-		for _, fn := range fns {
-			var nextF float64
-			next, tmpErr := fn.Exec(i, msg, legacy)
-			if tmpErr == nil {
-				nextF, tmpErr = getNumber(next)
-			}
+		for j, fn := range fns {
+			v, tmpErr := fn.Exec(i, msg, legacy)
 			if tmpErr != nil {
 				err = tmpErr
 				continue
 			}
-			total += nextF
+			values[j], resolved[j] = v, true
+		}
+
+		// If any resolved operand is a string then `+` means concatenation
+		// rather than numeric addition, and every resolved operand is
+		// stringified.
+		isConcat := false
+		for j := range values {
+			if !resolved[j] {
+				continue
+			}
+			if _, ok := values[j].(string); ok {
+				isConcat = true
+				break
+			}
+		}
+		if isConcat {
+			var sb strings.Builder
+			for j := range values {
+				if resolved[j] {
+					sb.WriteString(stringifyValue(values[j]))
+				}
+			}
+			if err != nil {
+				return nil, &ErrRecoverable{
+					Err:       err,
+					Recovered: sb.String(),
+				}
+			}
+			return sb.String(), nil
+		}
+
+		total := intNumber(0)
+		for j := range values {
+			if !resolved[j] {
+				continue
+			}
+			n, convErr := getNumber(values[j])
+			if convErr != nil {
+				err = convErr
+				continue
+			}
+			total = addNumbers(total, n)
 		}
 
 		if err != nil {
 			return nil, &ErrRecoverable{
 				Err:       err,
-				Recovered: total,
+				Recovered: total.Value(),
 			}
 		}
-		return total, nil
+		return total.Value(), nil
 	})
 }
 
 func sub(lhs, rhs Function) Function {
 	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
-		var total float64
+		total := intNumber(0)
 		var err error
 
 		if leftV, tmpErr := lhs.Exec(i, msg, legacy); tmpErr == nil {
@@ -124,11 +345,11 @@ func sub(lhs, rhs Function) Function {
 			err = tmpErr
 		}
 		if rightV, tmpErr := rhs.Exec(i, msg, legacy); tmpErr == nil {
-			var toSub float64
+			var toSub number
 			if toSub, tmpErr = getNumber(rightV); tmpErr != nil {
 				err = tmpErr
 			} else {
-				total -= toSub
+				total = subNumbers(total, toSub)
 			}
 		} else {
 			err = tmpErr
@@ -137,16 +358,16 @@ func sub(lhs, rhs Function) Function {
 		if err != nil {
 			return nil, &ErrRecoverable{
 				Err:       err,
-				Recovered: total,
+				Recovered: total.Value(),
 			}
 		}
-		return total, nil
+		return total.Value(), nil
 	})
 }
 
 func divide(lhs, rhs Function) Function {
 	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
-		var result float64
+		var result number
 		var err error
 
 		if leftV, tmpErr := lhs.Exec(i, msg, legacy); tmpErr == nil {
@@ -155,11 +376,11 @@ func divide(lhs, rhs Function) Function {
 			err = tmpErr
 		}
 		if rightV, tmpErr := rhs.Exec(i, msg, legacy); tmpErr == nil {
-			var denom float64
+			var denom number
 			if denom, tmpErr = getNumber(rightV); tmpErr != nil {
 				err = tmpErr
 			} else {
-				result = result / denom
+				result = divNumbers(result, denom)
 			}
 		} else {
 			err = tmpErr
@@ -168,79 +389,76 @@ func divide(lhs, rhs Function) Function {
 		if err != nil {
 			return nil, err
 		}
-		return result, nil
+		return result.Value(), nil
 	})
 }
 
 func multiply(lhs, rhs Function) Function {
 	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
-		var result float64
-		var err error
-
-		if leftV, tmpErr := lhs.Exec(i, msg, legacy); tmpErr == nil {
-			result, err = getNumber(leftV)
-		} else {
-			err = tmpErr
+		leftV, err := lhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
 		}
-		if rightV, tmpErr := rhs.Exec(i, msg, legacy); tmpErr == nil {
-			var denom float64
-			if denom, tmpErr = getNumber(rightV); tmpErr != nil {
-				err = tmpErr
-			} else {
-				result = result * denom
+		rightV, err := rhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+
+		if str, count, ok := stringRepeatOperands(leftV, rightV); ok {
+			if count < 0 {
+				return nil, fmt.Errorf("cannot repeat a string a negative number of times: %v", count)
 			}
-		} else {
-			err = tmpErr
+			return strings.Repeat(str, count), nil
 		}
 
+		lhsN, err := getNumber(leftV)
 		if err != nil {
 			return nil, err
 		}
-		return result, nil
+		rhsN, err := getNumber(rightV)
+		if err != nil {
+			return nil, err
+		}
+		return mulNumbers(lhsN, rhsN).Value(), nil
 	})
 }
 
 func compare(lhs, rhs Function, op arithmeticOp) (Function, error) {
-	var opFn func(lhs, rhs float64) bool
+	var intOp func(lhs, rhs int64) bool
+	var floatOp func(lhs, rhs float64) bool
 	switch op {
 	case arithmeticEq:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs == rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs == rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs == rhs }
 	case arithmeticNeq:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs != rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs != rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs != rhs }
 	case arithmeticGt:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs > rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs > rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs > rhs }
 	case arithmeticGte:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs >= rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs >= rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs >= rhs }
 	case arithmeticLt:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs < rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs < rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs < rhs }
 	case arithmeticLte:
-		opFn = func(lhs, rhs float64) bool {
-			return lhs <= rhs
-		}
+		intOp = func(lhs, rhs int64) bool { return lhs <= rhs }
+		floatOp = func(lhs, rhs float64) bool { return lhs <= rhs }
 	default:
 		return nil, fmt.Errorf("operator not supported: %v", op)
 	}
 	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
-		var lhsV, rhsV float64
+		var lhsN, rhsN number
 		var err error
 
 		if leftV, tmpErr := lhs.Exec(i, msg, legacy); tmpErr == nil {
-			lhsV, err = getNumber(leftV)
+			lhsN, err = getNumber(leftV)
 		} else {
 			err = tmpErr
 		}
 		if rightV, tmpErr := rhs.Exec(i, msg, legacy); tmpErr == nil {
-			if rhsV, tmpErr = getNumber(rightV); tmpErr != nil {
+			if rhsN, tmpErr = getNumber(rightV); tmpErr != nil {
 				err = tmpErr
 			}
 		} else {
@@ -249,68 +467,136 @@ func compare(lhs, rhs Function, op arithmeticOp) (Function, error) {
 		if err != nil {
 			return nil, err
 		}
-		return opFn(lhsV, rhsV), nil
+		// Compare as int64 when both sides are integral so that large IDs
+		// (beyond float64's 2^53 exact-integer range) don't lose precision.
+		if lhsN.isInt && rhsN.isInt {
+			return intOp(lhsN.i, rhsN.i), nil
+		}
+		return floatOp(lhsN.Float(), rhsN.Float()), nil
 	}), nil
 }
 
-func resolveArithmetic(fns []Function, ops []arithmeticOp) (Function, error) {
-	if len(fns) == 1 && len(ops) == 0 {
-		return fns[0], nil
+// power implements the right-associative `**` exponent operator.
+func power(lhs, rhs Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		leftV, err := lhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		rightV, err := rhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		lhsN, err := getNumber(leftV)
+		if err != nil {
+			return nil, err
+		}
+		rhsN, err := getNumber(rightV)
+		if err != nil {
+			return nil, err
+		}
+		if lhsN.isInt && rhsN.isInt && rhsN.i >= 0 {
+			result, base, exp := int64(1), lhsN.i, rhsN.i
+			for exp > 0 {
+				if exp&1 == 1 {
+					result *= base
+				}
+				base *= base
+				exp >>= 1
+			}
+			return result, nil
+		}
+		return math.Pow(lhsN.Float(), rhsN.Float()), nil
+	})
+}
+
+// arithmeticOpInfo describes how a single arithmeticOp binds during
+// precedence climbing: its binding power, its associativity, and how to
+// build the Function that implements it once both sides are resolved.
+type arithmeticOpInfo struct {
+	precedence int
+	rightAssoc bool
+	build      func(lhs, rhs Function) (Function, error)
+}
+
+func noErrBuild(fn func(lhs, rhs Function) Function) func(lhs, rhs Function) (Function, error) {
+	return func(lhs, rhs Function) (Function, error) {
+		return fn(lhs, rhs), nil
 	}
-	if len(fns) != (len(ops) + 1) {
-		return nil, fmt.Errorf("mismatch of functions to arithmetic operators")
+}
+
+func compareBuild(op arithmeticOp) func(lhs, rhs Function) (Function, error) {
+	return func(lhs, rhs Function) (Function, error) {
+		return compare(lhs, rhs, op)
 	}
+}
 
-	// First pass to resolve division and multiplication
-	fnsNew, opsNew := []Function{fns[0]}, []arithmeticOp{}
-	for i, op := range ops {
-		switch op {
-		case arithmeticMul:
-			fnsNew[len(fnsNew)-1] = multiply(fnsNew[len(fnsNew)-1], fns[i+1])
-		case arithmeticDiv:
-			fnsNew[len(fnsNew)-1] = divide(fnsNew[len(fnsNew)-1], fns[i+1])
-		default:
-			fnsNew = append(fnsNew, fns[i+1])
-			opsNew = append(opsNew, op)
+// arithmeticOpTable drives resolveArithmetic's precedence climbing. Adding a
+// new operator (bitwise, etc) is a matter of adding one entry here
+// rather than threading another hardcoded pass through resolveArithmetic.
+var arithmeticOpTable = map[arithmeticOp]arithmeticOpInfo{
+	arithmeticOr:       {precedence: 1, build: noErrBuild(logicalOr)},
+	arithmeticCoalesce: {precedence: 2, build: noErrBuild(coalesce)},
+	arithmeticAnd:      {precedence: 3, build: noErrBuild(logicalAnd)},
+	arithmeticEq:       {precedence: 4, build: compareBuild(arithmeticEq)},
+	arithmeticNeq:      {precedence: 4, build: compareBuild(arithmeticNeq)},
+	arithmeticGt:       {precedence: 4, build: compareBuild(arithmeticGt)},
+	arithmeticGte:      {precedence: 4, build: compareBuild(arithmeticGte)},
+	arithmeticLt:       {precedence: 4, build: compareBuild(arithmeticLt)},
+	arithmeticLte:      {precedence: 4, build: compareBuild(arithmeticLte)},
+	arithmeticAdd:      {precedence: 5, build: noErrBuild(func(lhs, rhs Function) Function { return add([]Function{lhs, rhs}) })},
+	arithmeticSub:      {precedence: 5, build: noErrBuild(sub)},
+	arithmeticMul:      {precedence: 6, build: noErrBuild(multiply)},
+	arithmeticDiv:      {precedence: 6, build: noErrBuild(divide)},
+	arithmeticMod:      {precedence: 6, build: noErrBuild(modulo)},
+	arithmeticPow:      {precedence: 7, rightAssoc: true, build: noErrBuild(power)},
+}
+
+// climbPrecedence implements precedence-climbing over the flattened
+// operand/operator lists produced by the grammar. It consumes operators
+// with a binding power of at least minPrec, recursing to resolve the rhs of
+// each one, and returns the resolved Function along with how far through
+// fns/ops it got.
+func climbPrecedence(fns []Function, ops []arithmeticOp, fi, oi, minPrec int) (lhs Function, nfi, noi int, err error) {
+	lhs = fns[fi]
+	fi++
+
+	for oi < len(ops) {
+		info, ok := arithmeticOpTable[ops[oi]]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("operator not supported: %v", ops[oi])
+		}
+		if info.precedence < minPrec {
+			break
 		}
-	}
-	fns, ops = fnsNew, opsNew
-	if len(fns) == 1 {
-		return fns[0], nil
-	}
 
-	// Next, resolve additions and subtractions
-	var addPile, subPile []Function
-	addPile = append(addPile, fns[0])
-	for i, op := range ops {
-		switch op {
-		case arithmeticAdd:
-			addPile = append(addPile, fns[i+1])
-		case arithmeticSub:
-			subPile = append(subPile, fns[i+1])
-		case arithmeticEq,
-			arithmeticNeq,
-			arithmeticGt,
-			arithmeticGte,
-			arithmeticLt,
-			arithmeticLte:
-			var rhs Function
-			lhs, err := resolveArithmetic(fns[:i+1], ops[:i])
-			if err == nil {
-				rhs, err = resolveArithmetic(fns[i+1:], ops[i+1:])
-			}
-			if err != nil {
-				return nil, err
-			}
-			return compare(lhs, rhs, op)
+		nextMinPrec := info.precedence + 1
+		if info.rightAssoc {
+			nextMinPrec = info.precedence
+		}
+
+		oi++
+		var rhs Function
+		rhs, fi, oi, err = climbPrecedence(fns, ops, fi, oi, nextMinPrec)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if lhs, err = info.build(lhs, rhs); err != nil {
+			return nil, 0, 0, err
 		}
 	}
+	return lhs, fi, oi, nil
+}
 
-	fn := add(addPile)
-	if len(subPile) > 0 {
-		fn = sub(fn, add(subPile))
+func resolveArithmetic(fns []Function, ops []arithmeticOp) (Function, error) {
+	if len(fns) == 1 && len(ops) == 0 {
+		return fns[0], nil
 	}
-	return fn, nil
+	if len(fns) != (len(ops) + 1) {
+		return nil, fmt.Errorf("mismatch of functions to arithmetic operators")
+	}
+	fn, _, _, err := climbPrecedence(fns, ops, 0, 0, 0)
+	return fn, err
 }
 
-//------------------------------------------------------------------------------
\ No newline at end of file
+//------------------------------------------------------------------------------
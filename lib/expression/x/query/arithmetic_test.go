@@ -0,0 +1,138 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+// constFn is a literal-valued Function used to build operand lists for
+// resolveArithmetic in tests below.
+type constFn struct {
+	v interface{}
+}
+
+func (c constFn) Exec(i int, msg Message, legacy bool) (interface{}, error) {
+	return c.v, nil
+}
+
+func lit(v interface{}) Function {
+	return constFn{v: v}
+}
+
+func TestResolveArithmeticPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		fns  []Function
+		ops  []arithmeticOp
+		want interface{}
+	}{
+		{
+			name: "multiplication binds tighter than addition",
+			fns:  []Function{lit(int64(2)), lit(int64(3)), lit(int64(4))},
+			ops:  []arithmeticOp{arithmeticAdd, arithmeticMul},
+			want: int64(14), // 2 + (3 * 4)
+		},
+		{
+			name: "modulo binds as tight as multiplication, tighter than subtraction",
+			fns:  []Function{lit(int64(10)), lit(int64(9)), lit(int64(4))},
+			ops:  []arithmeticOp{arithmeticSub, arithmeticMod},
+			want: int64(9), // 10 - (9 % 4)
+		},
+		{
+			name: "addition binds tighter than comparison",
+			fns:  []Function{lit(int64(1)), lit(int64(2)), lit(int64(3))},
+			ops:  []arithmeticOp{arithmeticAdd, arithmeticEq},
+			want: true, // (1 + 2) == 3
+		},
+		{
+			name: "comparison binds tighter than and",
+			fns:  []Function{lit(int64(1)), lit(int64(1)), lit(int64(2)), lit(int64(2))},
+			ops:  []arithmeticOp{arithmeticEq, arithmeticAnd, arithmeticEq},
+			want: true, // (1 == 1) && (2 == 2)
+		},
+		{
+			name: "and binds tighter than or",
+			fns:  []Function{lit(true), lit(false), lit(false)},
+			ops:  []arithmeticOp{arithmeticOr, arithmeticAnd},
+			want: true, // true || (false && false)
+		},
+		{
+			name: "coalesce sits between or and and",
+			fns:  []Function{lit(false), lit(nil), lit(true)},
+			ops:  []arithmeticOp{arithmeticOr, arithmeticCoalesce},
+			want: true, // false || (nil ?? true)
+		},
+		{
+			name: "exponent binds tighter than multiplication",
+			fns:  []Function{lit(int64(2)), lit(int64(3)), lit(int64(2))},
+			ops:  []arithmeticOp{arithmeticMul, arithmeticPow},
+			want: int64(18), // 2 * (3 ** 2)
+		},
+		{
+			name: "exponent is right-associative",
+			fns:  []Function{lit(int64(2)), lit(int64(3)), lit(int64(2))},
+			ops:  []arithmeticOp{arithmeticPow, arithmeticPow},
+			want: int64(512), // 2 ** (3 ** 2), not (2 ** 3) ** 2
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := resolveArithmetic(tt.fns, tt.ops)
+			if err != nil {
+				t.Fatalf("resolveArithmetic: %v", err)
+			}
+			got, err := fn.Exec(0, nil, false)
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuloByZero(t *testing.T) {
+	fn := modulo(lit(int64(10)), lit(int64(0)))
+	if _, err := fn.Exec(0, nil, false); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestMultiplyNegativeRepeatCount(t *testing.T) {
+	fn := multiply(lit("foo"), lit(int64(-1)))
+	if _, err := fn.Exec(0, nil, false); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestAddTypeMismatch(t *testing.T) {
+	fn := add([]Function{lit(true), lit(map[string]interface{}{})})
+	if _, err := fn.Exec(0, nil, false); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestLogicalAndShortCircuits(t *testing.T) {
+	calls := 0
+	sideEffect := closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		calls++
+		return nil, errors.New("rhs should not have been executed")
+	})
+
+	fn, err := resolveArithmetic([]Function{lit(false), sideEffect}, []arithmeticOp{arithmeticAnd})
+	if err != nil {
+		t.Fatalf("resolveArithmetic: %v", err)
+	}
+	got, err := fn.Exec(0, nil, false)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if got != false {
+		t.Errorf("got %v, want false", got)
+	}
+	if calls != 0 {
+		t.Errorf("rhs executed %d times, want 0 (short-circuit)", calls)
+	}
+}
@@ -0,0 +1,74 @@
+package query
+
+import (
+	"github.com/Jeffail/benthos/v3/lib/expression/x/parser"
+)
+
+//------------------------------------------------------------------------------
+
+// coalesce returns a Function that evaluates lhs and, if that fails
+// (recoverably or otherwise) or resolves to nil, falls back to evaluating
+// and returning rhs instead. This implements the `??` operator, e.g.
+// `json("maybe.missing.field") ?? "default"`.
+func coalesce(lhs, rhs Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		v, err := lhs.Exec(i, msg, legacy)
+		if err != nil || v == nil {
+			return rhs.Exec(i, msg, legacy)
+		}
+		return v, nil
+	})
+}
+
+// safeNavigate wraps fn so that a *recoverable* error (e.g. a missing path
+// segment in a field lookup) degrades to the value recovered from that error
+// instead of failing the mapping outright. Any other error is still propagated, so `?.` only
+// swallows the specific "couldn't find this part of the path" failure it's
+// meant for, not an unrelated execution error. It's the runtime counterpart
+// of the `?.` safe accessor, allowing it to compose with `??`.
+func safeNavigate(fn Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		v, err := fn.Exec(i, msg, legacy)
+		if err == nil {
+			return v, nil
+		}
+		if rec, ok := err.(*ErrRecoverable); ok {
+			return rec.Recovered, nil
+		}
+		return nil, err
+	})
+}
+
+// safeNavigateParser wraps an expression parser with support for a trailing
+// `?.` suffix, e.g. `foo.bar?.`. When present, the wrapped expression's
+// result is passed through safeNavigate so that a recoverable error (such
+// as a missing path segment) degrades to its recovered value instead of
+// failing the whole mapping.
+func safeNavigateParser(exprParser parser.Type) parser.Type {
+	accessor := parser.Match("?.")
+
+	return func(input []rune) parser.Result {
+		res := exprParser(input)
+		if res.Err != nil {
+			return res
+		}
+		fn, ok := res.Result.(Function)
+		if !ok {
+			return res
+		}
+
+		aRes := accessor(trimLeadingWhitespace(res.Remaining))
+		if aRes.Err != nil {
+			// No safe-navigation suffix present, return the plain
+			// expression.
+			return res
+		}
+
+		return parser.Result{
+			Result:    safeNavigate(fn),
+			Remaining: aRes.Remaining,
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
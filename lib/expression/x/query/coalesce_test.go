@@ -0,0 +1,100 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+var errTest = errors.New("test error")
+
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		name string
+		lhs  Function
+		want interface{}
+	}{
+		{
+			name: "non-nil lhs is returned as-is",
+			lhs:  lit("foo"),
+			want: "foo",
+		},
+		{
+			name: "nil lhs falls back to rhs",
+			lhs:  lit(nil),
+			want: "bar",
+		},
+		{
+			name: "erroring lhs falls back to rhs",
+			lhs: closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+				return nil, &ErrRecoverable{Err: errTest, Recovered: nil}
+			}),
+			want: "bar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := coalesce(tt.lhs, lit("bar"))
+			got, err := fn.Exec(0, nil, false)
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeNavigate(t *testing.T) {
+	t.Run("recoverable error degrades to the recovered value", func(t *testing.T) {
+		fn := safeNavigate(closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+			return nil, &ErrRecoverable{Err: errTest, Recovered: "fallback"}
+		}))
+		got, err := fn.Exec(0, nil, false)
+		if err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+		if got != "fallback" {
+			t.Errorf("got %v, want %v", got, "fallback")
+		}
+	})
+
+	t.Run("non-recoverable error is propagated", func(t *testing.T) {
+		fn := safeNavigate(closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+			return nil, errTest
+		}))
+		if _, err := fn.Exec(0, nil, false); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("successful result passes through unchanged", func(t *testing.T) {
+		fn := safeNavigate(lit("foo"))
+		got, err := fn.Exec(0, nil, false)
+		if err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+		if got != "foo" {
+			t.Errorf("got %v, want %v", got, "foo")
+		}
+	})
+}
+
+func TestParseExpressionSafeNavigateSuffix(t *testing.T) {
+	res := ParseExpression([]rune(`true ?. false`))
+	if res.Err != nil {
+		t.Fatalf("parse err: %v", res.Err)
+	}
+	fn, ok := res.Result.(Function)
+	if !ok {
+		t.Fatalf("result is not a Function: %T", res.Result)
+	}
+	got, err := fn.Exec(0, nil, false)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if got != true {
+		t.Errorf("got %v, want %v", got, true)
+	}
+}
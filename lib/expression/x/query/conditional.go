@@ -0,0 +1,90 @@
+package query
+
+import (
+	"errors"
+
+	"github.com/Jeffail/benthos/v3/lib/expression/x/parser"
+)
+
+//------------------------------------------------------------------------------
+
+// conditional returns a Function that evaluates cond and, based on its
+// truthiness, executes and returns the result of exactly one of ifTrue or
+// ifFalse. The branch that isn't selected is never executed, so any side
+// effects (or errors) it would otherwise produce are avoided.
+func conditional(cond, ifTrue, ifFalse Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		condV, err := cond.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(condV) {
+			return ifTrue.Exec(i, msg, legacy)
+		}
+		return ifFalse.Exec(i, msg, legacy)
+	})
+}
+
+func trimLeadingWhitespace(input []rune) []rune {
+	i := 0
+	for i < len(input) && (input[i] == ' ' || input[i] == '\t') {
+		i++
+	}
+	return input[i:]
+}
+
+// conditionalParser wraps an expression parser with support for a trailing
+// ternary suffix: `cond ? ifTrue : ifFalse`. It is intended to run after
+// resolveArithmetic so that the condition itself may be any arithmetic or
+// comparison expression already produced by that parser.
+func conditionalParser(exprParser parser.Type) parser.Type {
+	question := parser.Char('?')
+	colon := parser.Char(':')
+
+	return func(input []rune) parser.Result {
+		res := exprParser(input)
+		if res.Err != nil {
+			return res
+		}
+		condFn, ok := res.Result.(Function)
+		if !ok {
+			return res
+		}
+
+		qRes := question(trimLeadingWhitespace(res.Remaining))
+		if qRes.Err != nil {
+			// No ternary suffix present, return the plain expression.
+			return res
+		}
+
+		trueRes := exprParser(trimLeadingWhitespace(qRes.Remaining))
+		if trueRes.Err != nil {
+			return parser.Result{Remaining: input, Err: trueRes.Err}
+		}
+		trueFn, ok := trueRes.Result.(Function)
+		if !ok {
+			return parser.Result{Remaining: input, Err: errors.New("expected expression after '?'")}
+		}
+
+		cRes := colon(trimLeadingWhitespace(trueRes.Remaining))
+		if cRes.Err != nil {
+			return parser.Result{Remaining: input, Err: cRes.Err}
+		}
+
+		falseRes := exprParser(trimLeadingWhitespace(cRes.Remaining))
+		if falseRes.Err != nil {
+			return parser.Result{Remaining: input, Err: falseRes.Err}
+		}
+		falseFn, ok := falseRes.Result.(Function)
+		if !ok {
+			return parser.Result{Remaining: input, Err: errors.New("expected expression after ':'")}
+		}
+
+		return parser.Result{
+			Result:    conditional(condFn, trueFn, falseFn),
+			Remaining: falseRes.Remaining,
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,74 @@
+package query
+
+import "testing"
+
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Function
+		want interface{}
+	}{
+		{
+			name: "true condition selects ifTrue",
+			cond: lit(true),
+			want: "big",
+		},
+		{
+			name: "false condition selects ifFalse",
+			cond: lit(false),
+			want: "small",
+		},
+		{
+			name: "truthy non-bool condition selects ifTrue",
+			cond: lit(int64(4)),
+			want: "big",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := conditional(tt.cond, lit("big"), lit("small"))
+			got, err := fn.Exec(0, nil, false)
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalShortCircuits(t *testing.T) {
+	calls := 0
+	sideEffect := closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		calls++
+		return nil, nil
+	})
+
+	fn := conditional(lit(true), lit("big"), sideEffect)
+	if _, err := fn.Exec(0, nil, false); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("ifFalse executed %d times, want 0 (short-circuit)", calls)
+	}
+}
+
+func TestParseExpressionTernary(t *testing.T) {
+	res := ParseExpression([]rune(`4 > 3 ? "big" : "small"`))
+	if res.Err != nil {
+		t.Fatalf("parse err: %v", res.Err)
+	}
+	fn, ok := res.Result.(Function)
+	if !ok {
+		t.Fatalf("result is not a Function: %T", res.Result)
+	}
+	got, err := fn.Exec(0, nil, false)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if got != "big" {
+		t.Errorf("got %v, want %v", got, "big")
+	}
+}
@@ -0,0 +1,91 @@
+package query
+
+import (
+	"errors"
+
+	"github.com/Jeffail/benthos/v3/lib/expression/x/parser"
+)
+
+//------------------------------------------------------------------------------
+
+// logicalAnd returns a Function that evaluates lhs and, only if it is
+// truthy, evaluates and returns the truthiness of rhs. If lhs isn't truthy
+// rhs is never executed, which matters both for performance and because
+// Bloblang functions (e.g. uuid_v4()) can have side effects.
+func logicalAnd(lhs, rhs Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		lhsV, err := lhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		if !isTruthy(lhsV) {
+			return false, nil
+		}
+		rhsV, err := rhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		return isTruthy(rhsV), nil
+	})
+}
+
+// logicalOr returns a Function that evaluates lhs and, only if it isn't
+// truthy, evaluates and returns the truthiness of rhs. If lhs is truthy rhs
+// is never executed.
+func logicalOr(lhs, rhs Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		lhsV, err := lhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(lhsV) {
+			return true, nil
+		}
+		rhsV, err := rhs.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		return isTruthy(rhsV), nil
+	})
+}
+
+// logicalNot returns a Function that evaluates fn and inverts its
+// truthiness.
+func logicalNot(fn Function) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		v, err := fn.Exec(i, msg, legacy)
+		if err != nil {
+			return nil, err
+		}
+		return !isTruthy(v), nil
+	})
+}
+
+// notParser wraps an expression parser with support for a leading unary `!`
+// operator, e.g. `!foo`.
+func notParser(exprParser parser.Type) parser.Type {
+	bang := parser.Char('!')
+
+	return func(input []rune) parser.Result {
+		res := bang(input)
+		if res.Err != nil {
+			return exprParser(input)
+		}
+
+		inner := exprParser(res.Remaining)
+		if inner.Err != nil {
+			return parser.Result{Remaining: input, Err: inner.Err}
+		}
+		fn, ok := inner.Result.(Function)
+		if !ok {
+			return parser.Result{Remaining: input, Err: errors.New("expected expression after '!'")}
+		}
+
+		return parser.Result{
+			Result:    logicalNot(fn),
+			Remaining: inner.Remaining,
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
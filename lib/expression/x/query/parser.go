@@ -0,0 +1,194 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Jeffail/benthos/v3/lib/expression/x/parser"
+)
+
+//------------------------------------------------------------------------------
+
+// literalFn returns a Function that always resolves to v, regardless of the
+// message being mapped. It backs the literal atoms (numbers, strings,
+// booleans, null) that operator expressions are built out of.
+func literalFn(v interface{}) Function {
+	return closureFn(func(i int, msg Message, legacy bool) (interface{}, error) {
+		return v, nil
+	})
+}
+
+func parseNumberLiteral(input []rune) parser.Result {
+	i := 0
+	if i < len(input) && (input[i] == '+' || input[i] == '-') {
+		i++
+	}
+	start := i
+	for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+		i++
+	}
+	if i == start {
+		return parser.Result{Remaining: input, Err: errors.New("expected a number")}
+	}
+
+	isFloat := false
+	if i < len(input) && input[i] == '.' {
+		isFloat = true
+		i++
+		for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+			i++
+		}
+	}
+
+	raw := string(input[:i])
+	if isFloat {
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return parser.Result{Remaining: input, Err: err}
+		}
+		return parser.Result{Result: literalFn(f), Remaining: input[i:]}
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return parser.Result{Remaining: input, Err: err}
+	}
+	return parser.Result{Result: literalFn(n), Remaining: input[i:]}
+}
+
+func parseStringLiteral(input []rune) parser.Result {
+	if len(input) == 0 || input[0] != '"' {
+		return parser.Result{Remaining: input, Err: errors.New("expected a quoted string")}
+	}
+	i := 1
+	for i < len(input) && input[i] != '"' {
+		if input[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(input) {
+		return parser.Result{Remaining: input, Err: errors.New("unterminated string literal")}
+	}
+	return parser.Result{Result: literalFn(string(input[1:i])), Remaining: input[i+1:]}
+}
+
+func parseBoolLiteral(input []rune) parser.Result {
+	if res := parser.Match("true")(input); res.Err == nil {
+		return parser.Result{Result: literalFn(true), Remaining: res.Remaining}
+	}
+	if res := parser.Match("false")(input); res.Err == nil {
+		return parser.Result{Result: literalFn(false), Remaining: res.Remaining}
+	}
+	return parser.Result{Remaining: input, Err: errors.New("expected a boolean literal")}
+}
+
+func parseNullLiteral(input []rune) parser.Result {
+	res := parser.Match("null")(input)
+	if res.Err != nil {
+		return parser.Result{Remaining: input, Err: res.Err}
+	}
+	return parser.Result{Result: literalFn(nil), Remaining: res.Remaining}
+}
+
+func parseParenExpr(input []rune) parser.Result {
+	open, closeParen := parser.Char('('), parser.Char(')')
+
+	oRes := open(input)
+	if oRes.Err != nil {
+		return parser.Result{Remaining: input, Err: oRes.Err}
+	}
+	inner := ParseExpression(trimLeadingWhitespace(oRes.Remaining))
+	if inner.Err != nil {
+		return parser.Result{Remaining: input, Err: inner.Err}
+	}
+	cRes := closeParen(trimLeadingWhitespace(inner.Remaining))
+	if cRes.Err != nil {
+		return parser.Result{Remaining: input, Err: cRes.Err}
+	}
+	return parser.Result{Result: inner.Result, Remaining: cRes.Remaining}
+}
+
+// parseAtom parses a single operand of an expression: a parenthesised
+// sub-expression, a boolean/null literal, a quoted string, or a number. It's
+// the base case that the operator parsers build on.
+func parseAtom(input []rune) parser.Result {
+	for _, p := range []parser.Type{
+		parseParenExpr,
+		parseBoolLiteral,
+		parseNullLiteral,
+		parseStringLiteral,
+		parseNumberLiteral,
+	} {
+		if res := p(input); res.Err == nil {
+			return res
+		}
+	}
+	return parser.Result{Remaining: input, Err: errors.New("expected expression")}
+}
+
+// parseOperand wraps parseAtom with the operand-level prefixes/suffixes
+// that apply before arithmetic operators are considered: the unary `!`
+// operator and a trailing `?.` safe-navigation suffix.
+func parseOperand(input []rune) parser.Result {
+	return safeNavigateParser(notParser(parseAtom))(input)
+}
+
+// parseArithmetic parses a full arithmetic/comparison/logical expression: a
+// chain of operands separated by the operators arithmeticOpParser
+// recognizes, resolved into a single Function by resolveArithmetic.
+func parseArithmetic(input []rune) parser.Result {
+	opParser := arithmeticOpParser()
+
+	res := parseOperand(input)
+	if res.Err != nil {
+		return res
+	}
+	fn, ok := res.Result.(Function)
+	if !ok {
+		return parser.Result{Remaining: input, Err: errors.New("expected expression")}
+	}
+
+	fns := []Function{fn}
+	var ops []arithmeticOp
+	remaining := res.Remaining
+
+	for {
+		opRes := opParser(trimLeadingWhitespace(remaining))
+		if opRes.Err != nil {
+			break
+		}
+		op, ok := opRes.Result.(arithmeticOp)
+		if !ok {
+			break
+		}
+
+		operandRes := parseOperand(trimLeadingWhitespace(opRes.Remaining))
+		if operandRes.Err != nil {
+			return parser.Result{Remaining: input, Err: operandRes.Err}
+		}
+		operandFn, ok := operandRes.Result.(Function)
+		if !ok {
+			return parser.Result{Remaining: input, Err: errors.New("expected expression")}
+		}
+
+		ops = append(ops, op)
+		fns = append(fns, operandFn)
+		remaining = operandRes.Remaining
+	}
+
+	resolved, err := resolveArithmetic(fns, ops)
+	if err != nil {
+		return parser.Result{Remaining: input, Err: err}
+	}
+	return parser.Result{Result: resolved, Remaining: remaining}
+}
+
+// ParseExpression is the entry point for parsing a single Bloblang query
+// expression, composing the full operator precedence chain: arithmetic,
+// comparison and logical operators (parseArithmetic) with an optional
+// trailing ternary suffix (conditionalParser).
+func ParseExpression(input []rune) parser.Result {
+	return conditionalParser(parseArithmetic)(input)
+}
+
+//------------------------------------------------------------------------------